@@ -0,0 +1,21 @@
+package build // import "github.com/moby/moby/api/types/build"
+
+// ImageBuildOptions holds the information necessary to build images.
+type ImageBuildOptions struct {
+	Tags        []string
+	Dockerfile  string
+	NoCache     bool
+	Remove      bool
+	ForceRemove bool
+	PullParent  bool
+	Target      string
+	BuildArgs   map[string]*string
+	Labels      map[string]string
+}
+
+// CachePruneReport contains the response for Engine API:
+// POST "/build/prune"
+type CachePruneReport struct {
+	CachesDeleted  []string
+	SpaceReclaimed uint64
+}
@@ -0,0 +1,110 @@
+package build // import "github.com/moby/moby/api/types/build"
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ProgressEvent describes the state of a single build step at a point in
+// time. It is one line of the NDJSON stream produced by POST /build when
+// the client negotiates the structured progress format (see
+// ProgressAcceptHeader).
+type ProgressEvent struct {
+	Timestamp time.Time `json:"ts"`
+	Vertex    string    `json:"vertex"`
+	Step      string    `json:"step"`
+	Digest    string    `json:"digest,omitempty"`
+	Total     int64     `json:"total,omitempty"`
+	Current   int64     `json:"current,omitempty"`
+	Status    string    `json:"status"`
+	Cached    bool      `json:"cached,omitempty"`
+	Logs      string    `json:"logs,omitempty"`
+}
+
+// ProgressResult is carried by the terminal `{"result":...}` frame written
+// after a structured-progress build completes successfully.
+type ProgressResult struct {
+	ImageID  string   `json:"image_id"`
+	Tags     []string `json:"tags,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ProgressError is carried by the terminal `{"error":...}` frame written
+// when a structured-progress build fails.
+type ProgressError struct {
+	Message string `json:"message"`
+}
+
+const (
+	// ProgressAcceptHeader is the Accept header value that selects the
+	// structured NDJSON progress stream on POST /build, in place of the
+	// classic freeform `{"stream":...}` messages.
+	ProgressAcceptHeader = "application/vnd.docker.build.progress.v2+ndjson"
+
+	// ProgressQueryRawJSON is the `?progress=` query value equivalent to
+	// ProgressAcceptHeader.
+	ProgressQueryRawJSON = "rawjson"
+
+	// ProgressQueryOTLP is the `?progress=` query value that additionally
+	// packages progress as an OTLP-over-HTTP span export, for scraping by
+	// tracing backends.
+	ProgressQueryOTLP = "otlp"
+)
+
+// progressLine is the wire representation of one line of the NDJSON
+// stream: either a ProgressEvent, or one of the two terminal frames.
+type progressLine struct {
+	ProgressEvent
+	Result *ProgressResult `json:"result,omitempty"`
+	Error  *ProgressError  `json:"error,omitempty"`
+}
+
+// ProgressMessage is a single decoded frame of the structured progress
+// stream. Exactly one of Event, Result or Error is non-nil.
+type ProgressMessage struct {
+	Event  *ProgressEvent
+	Result *ProgressResult
+	Error  *ProgressError
+}
+
+// ProgressDecoder decodes the NDJSON progress stream produced by POST
+// /build in structured mode.
+type ProgressDecoder struct {
+	scanner *bufio.Scanner
+}
+
+// NewProgressDecoder returns a decoder that reads structured progress
+// frames from r, one per line, until io.EOF.
+func NewProgressDecoder(r io.Reader) *ProgressDecoder {
+	return &ProgressDecoder{scanner: bufio.NewScanner(r)}
+}
+
+// Decode reads and returns the next frame of the stream. It returns
+// io.EOF once the stream is exhausted.
+func (d *ProgressDecoder) Decode() (ProgressMessage, error) {
+	for d.scanner.Scan() {
+		line := d.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var pl progressLine
+		if err := json.Unmarshal(line, &pl); err != nil {
+			return ProgressMessage{}, err
+		}
+		switch {
+		case pl.Result != nil:
+			return ProgressMessage{Result: pl.Result}, nil
+		case pl.Error != nil:
+			return ProgressMessage{Error: pl.Error}, nil
+		default:
+			event := pl.ProgressEvent
+			return ProgressMessage{Event: &event}, nil
+		}
+	}
+	if err := d.scanner.Err(); err != nil {
+		return ProgressMessage{}, err
+	}
+	return ProgressMessage{}, io.EOF
+}
@@ -0,0 +1,55 @@
+package buildbackend // import "github.com/moby/moby/v2/daemon/server/buildbackend"
+
+import (
+	"io"
+
+	"github.com/moby/moby/api/types/build"
+)
+
+// BuildConfig is the configuration used by a Backend to run a build.
+type BuildConfig struct {
+	// Source is the build context, usually a tar stream.
+	Source io.ReadCloser
+	// Options holds the client-supplied build options.
+	Options *build.ImageBuildOptions
+	// ProgressWriter is used by the builder to stream progress back to the
+	// client while the build is running.
+	ProgressWriter ProgressWriter
+}
+
+// ProgressWriter is a data object to transport progress streams to the
+// client.
+type ProgressWriter struct {
+	// Output is where the builder writes progress output intended for the
+	// client (for example the classic `{"stream":"..."}` JSON messages).
+	Output io.Writer
+	// StdoutFormatter and StderrFormatter are wrappers of Output that
+	// stream the build log formatted for terminal display.
+	StdoutFormatter io.Writer
+	StderrFormatter io.Writer
+
+	// StructuredSink, when set, receives one typed event per build step in
+	// addition to (or instead of, depending on the negotiated response
+	// mode) the freeform messages written to Output. The classic builder
+	// and BuildKit builder both report progress through it so that any
+	// response mode sees the same event schema regardless of which
+	// backend produced it.
+	StructuredSink ProgressSink
+}
+
+// ProgressSink receives structured, per-step build progress. Implementations
+// are provided by the router and translate events into the response format
+// the client negotiated, e.g. NDJSON or OTLP spans.
+type ProgressSink interface {
+	// Event reports the state of a single build step.
+	Event(build.ProgressEvent) error
+}
+
+// CachePruneOptions holds the options for the build cache pruning.
+type CachePruneOptions struct {
+	All           bool
+	ReservedSpace int64
+	MaxUsedSpace  int64
+	MinFreeSpace  int64
+	Filters       map[string][]string
+}
@@ -0,0 +1,38 @@
+package httputils // import "github.com/moby/moby/v2/daemon/server/httputils"
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// APIFunc is an adapter to allow the use of ordinary functions as Docker API
+// endpoints. Any URL path variables from the router are passed in the vars
+// map.
+type APIFunc func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error
+
+// APIVersionKey is the context key for the API version of a request.
+type APIVersionKey struct{}
+
+// VersionFromContext returns the API version set on the context, if any.
+func VersionFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(APIVersionKey{}).(string)
+	return v, ok
+}
+
+// WriteJSON writes the value v to the http response stream as json with
+// standard json encoding.
+func WriteJSON(w http.ResponseWriter, code int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	return json.NewEncoder(w).Encode(v)
+}
+
+// BoolValue transforms a form value into a boolean. An empty value and the
+// case-insensitive spellings "0", "no", "false" and "none" are false; any
+// other value is true.
+func BoolValue(r *http.Request, k string) bool {
+	s := strings.ToLower(r.FormValue(k))
+	return !(s == "" || s == "0" || s == "no" || s == "false" || s == "none")
+}
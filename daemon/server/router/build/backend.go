@@ -0,0 +1,22 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"context"
+
+	"github.com/moby/moby/api/types/build"
+	"github.com/moby/moby/v2/daemon/server/buildbackend"
+)
+
+// Backend is the methods that need to be implemented to provide image
+// building functionality to the build router.
+type Backend interface {
+	// Build starts a new build from the given configuration and returns
+	// the ID of the resulting image.
+	Build(ctx context.Context, config buildbackend.BuildConfig) (string, error)
+
+	// PruneCache removes build cache that is no longer needed.
+	PruneCache(ctx context.Context, opts buildbackend.CachePruneOptions) (*build.CachePruneReport, error)
+
+	// Cancel cancels the build identified by id.
+	Cancel(ctx context.Context, id string) error
+}
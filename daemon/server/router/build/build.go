@@ -0,0 +1,127 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/moby/moby/v2/daemon/server/router"
+)
+
+type experimentalProvider interface {
+	HasExperimental() bool
+}
+
+// buildRouter is a router to talk with the build controller.
+type buildRouter struct {
+	backend Backend
+	daemon  experimentalProvider
+	routes  []router.Route
+
+	// stagingDir is where partially-received, resumable build contexts are
+	// persisted until the declared Upload-Length has arrived. NewRouter sets
+	// it to defaultStagingDir unless WithStagingDir is given.
+	stagingDir string
+	// maxUploadSize caps the Upload-Length a client may declare for a
+	// resumable upload. Zero means no daemon-side limit.
+	maxUploadSize int64
+	// remoteContextTimeout bounds how long fetchRemoteContext waits on a
+	// remote tarball URL. Zero (the default) uses defaultRemoteContextTimeout.
+	remoteContextTimeout time.Duration
+
+	mu      sync.Mutex
+	uploads map[string]*resumableUpload
+
+	// activeMu guards activeBuilds, the registry of builds currently
+	// running under a client-supplied buildid, used by getBuildStatus and
+	// postBuildCancel.
+	activeMu     sync.Mutex
+	activeBuilds map[string]*activeBuild
+
+	// contextFilters run, in order, over the build context of POST /build
+	// (inline or fetched from a URL) before postBuild hands it to the
+	// backend. Contexts completed through a resumable upload are not
+	// filtered.
+	contextFilters []ContextFilter
+
+	// dumpDir, when non-empty, enables capturing every /build request and
+	// its response for post-mortem debugging. It is set with WithDumpDir.
+	dumpDir string
+	// isLocalSocket overrides how getBuildDumps decides a request came in
+	// over the daemon's local socket. Nil uses the RemoteAddr heuristic in
+	// isLocalSocketRequest.
+	isLocalSocket func(*http.Request) bool
+}
+
+// NewRouter initializes a new build router.
+func NewRouter(b Backend, daemon experimentalProvider, opts ...Option) router.Router {
+	r := &buildRouter{
+		backend:      b,
+		daemon:       daemon,
+		stagingDir:   defaultStagingDir,
+		uploads:      make(map[string]*resumableUpload),
+		activeBuilds: make(map[string]*activeBuild),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.initRoutes()
+	return r
+}
+
+// Option configures a buildRouter created by NewRouter.
+type Option func(*buildRouter)
+
+// WithStagingDir overrides the directory used to persist resumable build
+// contexts while they are being uploaded.
+func WithStagingDir(dir string) Option {
+	return func(r *buildRouter) { r.stagingDir = dir }
+}
+
+// WithMaxUploadSize sets the largest Upload-Length a client is allowed to
+// declare for a resumable build-context upload.
+func WithMaxUploadSize(n int64) Option {
+	return func(r *buildRouter) { r.maxUploadSize = n }
+}
+
+// WithRemoteContextTimeout overrides how long fetchRemoteContext waits on a
+// remote tarball URL (X-Build-Context-Source: url) before giving up.
+func WithRemoteContextTimeout(d time.Duration) Option {
+	return func(r *buildRouter) { r.remoteContextTimeout = d }
+}
+
+// WithDumpDir enables request/response dumping for /build, writing each
+// request under dir. An empty dir (the default) disables dumping.
+func WithDumpDir(dir string) Option {
+	return func(r *buildRouter) { r.dumpDir = dir }
+}
+
+// WithLocalSocketCheck overrides how getBuildDumps recognizes a request
+// that arrived over the daemon's local socket.
+func WithLocalSocketCheck(fn func(*http.Request) bool) Option {
+	return func(r *buildRouter) { r.isLocalSocket = fn }
+}
+
+// Routes returns the available routers to the build controller.
+func (br *buildRouter) Routes() []router.Route {
+	return br.routes
+}
+
+func (br *buildRouter) initRoutes() {
+	br.routes = []router.Route{
+		router.NewPostRoute("/build", br.withDump(br.postBuild)),
+		router.NewPostRoute("/build/prune", br.postPrune),
+		router.NewGetRoute("/build/dumps", br.getBuildDumps),
+		// /build/{id:.*}/cancel must be registered before the bare
+		// /build/{id:.*} catch-all below: {id:.*} matches slashes, and
+		// moby's mux matches routes in registration order, so a
+		// longer-suffix literal route is shadowed if it comes after the
+		// catch-all that also matches its prefix.
+		router.NewPostRoute("/build/{id:.*}/cancel", br.postBuildCancel),
+		router.NewPostRoute("/build/{id:.*}", br.postBuildContext),
+		router.NewPatchRoute("/build/{id:.*}", br.patchBuildContext),
+		router.NewHeadRoute("/build/{id:.*}", br.headBuildContext),
+		router.NewDeleteRoute("/build/{id:.*}", br.deleteBuildContext),
+		router.NewGetRoute("/build/{id:.*}", br.getBuildStatus),
+	}
+}
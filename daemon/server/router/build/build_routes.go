@@ -0,0 +1,309 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/log"
+
+	"github.com/moby/moby/v2/daemon/server/buildbackend"
+	"github.com/moby/moby/v2/daemon/server/httputils"
+)
+
+const (
+	// resumableContentType negotiates the TUS-inspired chunked upload
+	// protocol; postBuildContext requires it on POST /build/{id}.
+	resumableContentType = "application/vnd.docker.build-context+resumable"
+
+	// buildContextSourceHeader tells postBuild how to obtain the build
+	// context: as an inline tar body (the default, for backward
+	// compatibility) or a remote tarball URL. postBuild rejects "tus";
+	// resumable uploads are created with POST /build/{id} instead.
+	buildContextSourceHeader = "X-Build-Context-Source"
+
+	buildContextSourceInline = "inline"
+	buildContextSourceURL    = "url"
+	buildContextSourceTUS    = "tus"
+
+	// defaultRemoteContextTimeout bounds how long fetchRemoteContext waits
+	// on a remote tarball URL when the buildRouter wasn't constructed with
+	// WithRemoteContextTimeout.
+	defaultRemoteContextTimeout = 30 * time.Second
+)
+
+// postBuild builds a new image from a build context. The build context is
+// read from the request body by default, but can also be a remote tarball
+// URL (X-Build-Context-Source: url). X-Build-Context-Source: tus is
+// rejected here: resumable, TUS-style chunked uploads are created and
+// continued via postBuildContext/patchBuildContext against /build/{id}.
+func (br *buildRouter) postBuild(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+
+	if r.Body != nil {
+		if err := http.NewResponseController(w).EnableFullDuplex(); err != nil {
+			log.G(ctx).WithError(err).Warn("could not enable full duplex on /build response")
+		}
+	}
+
+	// A client that supplies buildid can later poll getBuildStatus or call
+	// postBuildCancel against it; the deferred cancel below tears down the
+	// build's context regardless of how the handler exits.
+	buildID := r.FormValue("buildid")
+	var active *activeBuild
+	cancel := func() {}
+	if buildID != "" {
+		ctx, cancel = context.WithCancel(ctx)
+		active = br.registerActiveBuild(buildID, cancel)
+	}
+	defer func() {
+		if buildID != "" {
+			br.unregisterActiveBuild(buildID)
+		}
+		cancel()
+	}()
+
+	source, err := br.resolveBuildSource(ctx, r)
+	if err != nil {
+		return err
+	}
+	if source != nil && len(br.contextFilters) > 0 {
+		filtered, ferr := br.applyContextFilters(r, source)
+		closeErr := source.Close()
+		if ferr != nil {
+			return ferr
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+		source = toReadCloser(filtered)
+	}
+	if source != nil {
+		defer source.Close()
+	}
+
+	pw := newProgressWriter(w, r)
+	if active != nil {
+		if source != nil {
+			source = active.countingReader(source)
+		}
+		// Track step/cache status regardless of the negotiated response
+		// mode: wrapSink feeds active's counters in classic mode too,
+		// where StructuredSink would otherwise be nil.
+		pw.StructuredSink = active.wrapSink(pw.StructuredSink)
+	}
+
+	config := buildbackend.BuildConfig{
+		Source:         source,
+		ProgressWriter: pw,
+	}
+
+	imageID, err := br.backend.Build(ctx, config)
+	return writeBuildOutcome(config.ProgressWriter, imageID, err)
+}
+
+// resolveBuildSource returns the tar stream to build from, based on the
+// X-Build-Context-Source header.
+func (br *buildRouter) resolveBuildSource(ctx context.Context, r *http.Request) (io.ReadCloser, error) {
+	source := r.Header.Get(buildContextSourceHeader)
+	if source == "" {
+		source = buildContextSourceInline
+	}
+
+	switch source {
+	case buildContextSourceInline:
+		return r.Body, nil
+
+	case buildContextSourceURL:
+		return br.fetchRemoteContext(ctx, r)
+
+	case buildContextSourceTUS:
+		return nil, fmt.Errorf("%s: tus uploads must be created via POST /build/{id}, not /build", buildContextSourceHeader)
+
+	default:
+		return nil, fmt.Errorf("unsupported %s: %q", buildContextSourceHeader, source)
+	}
+}
+
+// fetchRemoteContext downloads a tarball build context from the URL given
+// in the request body and returns it as the build's Source. The fetch is
+// bound to ctx, so it is cancelled along with the build (client disconnect,
+// postBuildCancel) and bounded by remoteContextTimeout regardless.
+func (br *buildRouter) fetchRemoteContext(ctx context.Context, r *http.Request) (io.ReadCloser, error) {
+	raw, err := io.ReadAll(io.LimitReader(r.Body, 2048))
+	if err != nil {
+		return nil, fmt.Errorf("reading remote build context URL: %w", err)
+	}
+
+	remote := strings.TrimSpace(string(raw))
+	u, err := url.Parse(remote)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid remote build context URL %q", remote)
+	}
+
+	timeout := br.remoteContextTimeout
+	if timeout <= 0 {
+		timeout = defaultRemoteContextTimeout
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+
+	req, err := http.NewRequestWithContext(fetchCtx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("building remote build context request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("fetching remote build context: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("fetching remote build context: unexpected status %s", resp.Status)
+	}
+	return &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+// cancelOnCloseBody releases the context.WithTimeout created for a remote
+// build context fetch once the response body is closed, so the timer doesn't
+// leak for the lifetime of the build.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// postBuildContext creates a resumable upload session for the build
+// context identified by buildid. It is the "POST to create an upload slot"
+// step of the TUS-inspired protocol; chunks are appended with
+// patchBuildContext.
+func (br *buildRouter) postBuildContext(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	id := vars["id"]
+	if id == "" {
+		return fmt.Errorf("missing build id")
+	}
+	if ct := r.Header.Get("Content-Type"); ct != resumableContentType {
+		return fmt.Errorf("creating a resumable build context upload requires Content-Type: %s, got %q", resumableContentType, ct)
+	}
+	if _, exists := br.getUpload(id); exists {
+		return fmt.Errorf("build context upload %q already exists", id)
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return fmt.Errorf("missing or invalid Upload-Length header")
+	}
+	if br.maxUploadSize > 0 && length > br.maxUploadSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return nil
+	}
+
+	if _, err := br.newUpload(id, length); err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", "/build/"+id)
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// patchBuildContext appends a chunk to a resumable build-context upload. It
+// starts the build once the declared Upload-Length has been received.
+func (br *buildRouter) patchBuildContext(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	id := vars["id"]
+	u, ok := br.getUpload(id)
+	if !ok {
+		http.Error(w, "no such build context upload", http.StatusNotFound)
+		return nil
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "application/offset+octet-stream" {
+		return fmt.Errorf("unsupported Content-Type %q for build context chunk", ct)
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid Upload-Offset header")
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("reading build context chunk: %w", err)
+	}
+
+	newOffset, err := u.appendChunk(offset, data)
+	if err != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return nil
+	}
+
+	if !u.complete() {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	// The full context has arrived: assemble it and hand it to the backend.
+	br.removeUpload(id)
+	f, err := openStagedContext(u.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	config := buildbackend.BuildConfig{
+		Source:         f,
+		ProgressWriter: newProgressWriter(w, r),
+	}
+	imageID, err := br.backend.Build(ctx, config)
+	return writeBuildOutcome(config.ProgressWriter, imageID, err)
+}
+
+// headBuildContext reports how many bytes of a resumable upload the daemon
+// has received so far, letting a client resume after a dropped connection.
+func (br *buildRouter) headBuildContext(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	u, ok := br.getUpload(vars["id"])
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	u.mu.Lock()
+	offset, length := u.offset, u.length
+	u.mu.Unlock()
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// deleteBuildContext abandons a resumable upload and discards any bytes
+// already staged for it.
+func (br *buildRouter) deleteBuildContext(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	br.removeUpload(vars["id"])
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (br *buildRouter) postPrune(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	report, err := br.backend.PruneCache(ctx, buildbackend.CachePruneOptions{
+		All: httputils.BoolValue(r, "all"),
+	})
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, report)
+}
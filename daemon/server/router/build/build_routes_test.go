@@ -6,7 +6,9 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 
@@ -17,7 +19,8 @@ import (
 
 // mockBackend is a mock implementation of the Backend interface for testing.
 type mockBackend struct {
-	buildFunc func(context.Context, buildbackend.BuildConfig) (string, error)
+	buildFunc  func(context.Context, buildbackend.BuildConfig) (string, error)
+	cancelFunc func(context.Context, string) error
 }
 
 func (m *mockBackend) Build(ctx context.Context, config buildbackend.BuildConfig) (string, error) {
@@ -32,6 +35,9 @@ func (m *mockBackend) PruneCache(ctx context.Context, opts buildbackend.CachePru
 }
 
 func (m *mockBackend) Cancel(ctx context.Context, id string) error {
+	if m.cancelFunc != nil {
+		return m.cancelFunc(ctx, id)
+	}
 	return nil
 }
 
@@ -205,3 +211,72 @@ func TestPostBuild_FullDuplex_ConcurrentReadWrite(t *testing.T) {
 	assert.Assert(t, bytes.Contains([]byte(responseBody), []byte("Starting build")), "Response should contain progress output")
 }
 
+func TestFetchRemoteContext_FetchesBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tar-bytes"))
+	}))
+	defer srv.Close()
+
+	br := &buildRouter{}
+	req := httptest.NewRequest(http.MethodPost, "/build", strings.NewReader(srv.URL))
+	rc, err := br.fetchRemoteContext(req.Context(), req)
+	assert.NilError(t, err)
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "tar-bytes")
+}
+
+func TestFetchRemoteContext_RejectsNonHTTPScheme(t *testing.T) {
+	br := &buildRouter{}
+	req := httptest.NewRequest(http.MethodPost, "/build", strings.NewReader("file:///etc/passwd"))
+	_, err := br.fetchRemoteContext(req.Context(), req)
+	assert.ErrorContains(t, err, "invalid remote build context URL")
+}
+
+func TestFetchRemoteContext_BoundByTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// srv.Close (deferred after close(block), so it runs first) waits
+		// for this handler; return once the client abandons the request.
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	br := &buildRouter{remoteContextTimeout: 10 * time.Millisecond}
+	req := httptest.NewRequest(http.MethodPost, "/build", strings.NewReader(srv.URL))
+	_, err := br.fetchRemoteContext(req.Context(), req)
+	assert.ErrorContains(t, err, "fetching remote build context")
+}
+
+func TestFetchRemoteContext_CancelledByParentContext(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	br := &buildRouter{}
+	req := httptest.NewRequest(http.MethodPost, "/build", strings.NewReader(srv.URL))
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := br.fetchRemoteContext(ctx, req)
+		errCh <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	err := <-errCh
+	assert.ErrorContains(t, err, "fetching remote build context")
+}
@@ -0,0 +1,35 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/moby/moby/v2/daemon/server/httputils"
+)
+
+// getBuildStatus reports live progress for a build registered under the
+// buildid it was started with: bytes read from the context so far, the
+// current step, elapsed time and cache-hit ratio.
+func (br *buildRouter) getBuildStatus(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	active, ok := br.getActiveBuild(vars["id"])
+	if !ok {
+		http.Error(w, "no such build", http.StatusNotFound)
+		return nil
+	}
+	return httputils.WriteJSON(w, http.StatusOK, active.snapshot())
+}
+
+// postBuildCancel aborts the build identified by id without requiring the
+// client to drop the underlying connection: it forwards to backend.Cancel
+// and, if the build is registered locally, cancels its context too.
+func (br *buildRouter) postBuildCancel(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	id := vars["id"]
+	if err := br.backend.Cancel(ctx, id); err != nil {
+		return err
+	}
+	if active, ok := br.getActiveBuild(id); ok {
+		active.cancel()
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,58 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"io"
+	"net/http"
+)
+
+// ContextFilter transforms a build context tar stream before it reaches
+// the backend, for example to strip ignored files or rehydrate entries the
+// daemon already holds in a local cache. Filters run in the order
+// configured on the buildRouter, each taking the previous filter's output
+// as its input.
+type ContextFilter interface {
+	Filter(r io.Reader) (io.Reader, error)
+}
+
+// requestScopedContextFilter is implemented by filters that need
+// per-request state, such as a client-supplied header, in addition to the
+// tar stream itself. applyContextFilters binds it before running the
+// filter, so ContextFilter itself can stay a plain Reader-to-Reader
+// interface.
+type requestScopedContextFilter interface {
+	ContextFilter
+	forRequest(r *http.Request) ContextFilter
+}
+
+// WithContextFilters configures the chain of ContextFilters that postBuild
+// runs over its build context (inline or fetched from a URL) before
+// handing it to the backend.
+func WithContextFilters(filters ...ContextFilter) Option {
+	return func(r *buildRouter) { r.contextFilters = filters }
+}
+
+// applyContextFilters runs source through the configured filter chain and
+// returns the final reader. It returns source unchanged, without touching
+// it, when no filters are configured.
+func (br *buildRouter) applyContextFilters(r *http.Request, source io.Reader) (io.Reader, error) {
+	for _, f := range br.contextFilters {
+		if scoped, ok := f.(requestScopedContextFilter); ok {
+			f = scoped.forRequest(r)
+		}
+		filtered, err := f.Filter(source)
+		if err != nil {
+			return nil, err
+		}
+		source = filtered
+	}
+	return source, nil
+}
+
+// toReadCloser adapts the io.Reader a ContextFilter chain produces back
+// into the io.ReadCloser that BuildConfig.Source expects.
+func toReadCloser(r io.Reader) io.ReadCloser {
+	if rc, ok := r.(io.ReadCloser); ok {
+		return rc
+	}
+	return io.NopCloser(r)
+}
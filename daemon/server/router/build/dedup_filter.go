@@ -0,0 +1,196 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// digestPattern matches a well-formed lowercase sha256 hex digest. Any
+// digest that reaches a filesystem path (in hydrate or store) must match
+// this before use, since it otherwise comes straight from a client-supplied
+// PAX record.
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// dedupManifestHeader carries the sha256 digests of entries the client
+// omitted from a build context tar because it believes the daemon's blob
+// cache already holds them (from an earlier build). DedupFilter rehydrates
+// those entries before the context reaches the backend.
+const dedupManifestHeader = "X-Build-Context-Manifest"
+
+// dedupDigestPAXKey is the PAX record a client sets on a placeholder entry
+// (size 0) to say which cached blob it stands in for.
+const dedupDigestPAXKey = "DOCKER.dedup.sha256"
+
+// defaultBlobCacheDir is where DedupFilter persists content-addressed
+// blobs when constructed with NewDedupFilter.
+const defaultBlobCacheDir = "/var/lib/docker/build-context-cache"
+
+// DedupFilter is a ContextFilter that deduplicates build-context uploads
+// against a daemon-local, content-addressable blob cache: entries the
+// client already believes are cached are sent as size-0 placeholders
+// tagged with their digest, and DedupFilter rehydrates them from disk. New
+// entries are hashed and stored so future builds can be deduplicated
+// against them.
+type DedupFilter struct {
+	cacheDir string
+}
+
+// NewDedupFilter returns a ContextFilter backed by the given blob cache
+// directory. An empty dir uses defaultBlobCacheDir.
+func NewDedupFilter(cacheDir string) *DedupFilter {
+	if cacheDir == "" {
+		cacheDir = defaultBlobCacheDir
+	}
+	return &DedupFilter{cacheDir: cacheDir}
+}
+
+// forRequest binds the client's manifest header so Filter knows which
+// placeholder digests it is allowed to trust for this request.
+func (f *DedupFilter) forRequest(r *http.Request) ContextFilter {
+	return &boundDedupFilter{
+		DedupFilter: f,
+		manifest:    parseDedupManifest(r.Header.Get(dedupManifestHeader)),
+	}
+}
+
+// Filter runs the dedup pass with an empty manifest, so any placeholder
+// entry is rejected. It exists to satisfy ContextFilter for callers that
+// don't route requests through forRequest (e.g. tests).
+func (f *DedupFilter) Filter(r io.Reader) (io.Reader, error) {
+	return f.filter(r, nil)
+}
+
+type boundDedupFilter struct {
+	*DedupFilter
+	manifest map[string]struct{}
+}
+
+func (b *boundDedupFilter) Filter(r io.Reader) (io.Reader, error) {
+	return b.filter(r, b.manifest)
+}
+
+func parseDedupManifest(header string) map[string]struct{} {
+	if header == "" {
+		return nil
+	}
+	manifest := make(map[string]struct{})
+	for _, digest := range strings.Split(header, ",") {
+		digest = strings.TrimSpace(digest)
+		if digest != "" {
+			manifest[digest] = struct{}{}
+		}
+	}
+	return manifest
+}
+
+func (f *DedupFilter) filter(r io.Reader, manifest map[string]struct{}) (io.Reader, error) {
+	out, err := os.CreateTemp("", "build-context-dedup-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("creating deduplicated build context: %w", err)
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+
+	tw := tar.NewWriter(out)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading build context: %w", err)
+		}
+
+		if digest, isPlaceholder := hdr.PAXRecords[dedupDigestPAXKey]; isPlaceholder && hdr.Size == 0 {
+			if !digestPattern.MatchString(digest) {
+				return nil, fmt.Errorf("build context entry %q references malformed cached digest %q", hdr.Name, digest)
+			}
+			if _, declared := manifest[digest]; !declared {
+				return nil, fmt.Errorf("build context entry %q references undeclared cached digest %q", hdr.Name, digest)
+			}
+			if err := f.hydrate(tw, hdr, digest); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading build context entry %s: %w", hdr.Name, err)
+		}
+		if len(data) > 0 {
+			f.store(sha256Hex(data), data)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	ok = true
+	return &removeOnCloseFile{File: out}, nil
+}
+
+// hydrate rewrites a placeholder header with the cached blob's real size
+// and writes the cached content in its place.
+func (f *DedupFilter) hydrate(tw *tar.Writer, hdr *tar.Header, digest string) error {
+	if !digestPattern.MatchString(digest) {
+		return fmt.Errorf("malformed cached digest %q referenced by %s", digest, hdr.Name)
+	}
+	data, err := os.ReadFile(filepath.Join(f.cacheDir, digest))
+	if err != nil {
+		return fmt.Errorf("no cached blob for digest %s referenced by %s: %w", digest, hdr.Name, err)
+	}
+	hdr.Size = int64(len(data))
+	delete(hdr.PAXRecords, dedupDigestPAXKey)
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// store persists data under its own digest, if it isn't cached already.
+func (f *DedupFilter) store(digest string, data []byte) {
+	if !digestPattern.MatchString(digest) {
+		return
+	}
+	if err := os.MkdirAll(f.cacheDir, 0o700); err != nil {
+		return
+	}
+	path := filepath.Join(f.cacheDir, digest)
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, path)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func writeTar(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, body := range entries {
+		assert.NilError(t, tw.WriteHeader(&tar.Header{Name: name, Size: int64(len(body)), Mode: 0o644}))
+		_, err := tw.Write([]byte(body))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func readTarNames(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	out := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		data, err := io.ReadAll(tr)
+		assert.NilError(t, err)
+		out[hdr.Name] = string(data)
+	}
+	return out
+}
+
+func TestDedupFilter_StoresNewEntries(t *testing.T) {
+	dir := t.TempDir()
+	f := NewDedupFilter(dir)
+
+	input := writeTar(t, map[string]string{"app/main.go": "package main"})
+	out, err := f.Filter(bytes.NewReader(input))
+	assert.NilError(t, err)
+
+	entries := readTarNames(t, out)
+	assert.Equal(t, entries["app/main.go"], "package main")
+
+	digest := sha256Hex([]byte("package main"))
+	data, err := os.ReadFile(filepath.Join(dir, digest))
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "package main")
+}
+
+func TestDedupFilter_HydratesDeclaredPlaceholder(t *testing.T) {
+	dir := t.TempDir()
+	f := NewDedupFilter(dir)
+
+	// Prime the cache the way a prior build would have.
+	digest := sha256Hex([]byte("cached content"))
+	f.store(digest, []byte("cached content"))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NilError(t, tw.WriteHeader(&tar.Header{
+		Name:       "app/cached.txt",
+		Size:       0,
+		Mode:       0o644,
+		PAXRecords: map[string]string{dedupDigestPAXKey: digest},
+	}))
+	assert.NilError(t, tw.Close())
+
+	req := httptest.NewRequest("POST", "/build", nil)
+	req.Header.Set(dedupManifestHeader, digest)
+	bound := f.forRequest(req)
+
+	out, err := bound.Filter(&buf)
+	assert.NilError(t, err)
+	entries := readTarNames(t, out)
+	assert.Equal(t, entries["app/cached.txt"], "cached content")
+}
+
+func TestDedupFilter_RejectsUndeclaredDigest(t *testing.T) {
+	dir := t.TempDir()
+	f := NewDedupFilter(dir)
+
+	digest := sha256Hex([]byte("cached content"))
+	f.store(digest, []byte("cached content"))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NilError(t, tw.WriteHeader(&tar.Header{
+		Name:       "app/cached.txt",
+		Size:       0,
+		PAXRecords: map[string]string{dedupDigestPAXKey: digest},
+	}))
+	assert.NilError(t, tw.Close())
+
+	// No forRequest binding: an empty manifest must reject the placeholder.
+	_, err := f.Filter(&buf)
+	assert.ErrorContains(t, err, "undeclared cached digest")
+}
+
+func TestDedupFilter_RejectsMalformedDigest(t *testing.T) {
+	dir := t.TempDir()
+	f := NewDedupFilter(dir)
+
+	malformed := "../../../../etc/shadow"
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NilError(t, tw.WriteHeader(&tar.Header{
+		Name:       "app/evil.txt",
+		Size:       0,
+		PAXRecords: map[string]string{dedupDigestPAXKey: malformed},
+	}))
+	assert.NilError(t, tw.Close())
+
+	req := httptest.NewRequest("POST", "/build", nil)
+	req.Header.Set(dedupManifestHeader, malformed)
+	bound := f.forRequest(req)
+
+	// The manifest declares the same malicious string the client controls,
+	// so only digest-shape validation (not the manifest check) can catch
+	// this; a path-traversal digest must be rejected before hitting disk.
+	_, err := bound.Filter(&buf)
+	assert.ErrorContains(t, err, "malformed cached digest")
+}
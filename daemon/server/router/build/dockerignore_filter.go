@@ -0,0 +1,215 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dockerignorePattern is one line of a .dockerignore file: a path glob,
+// optionally negated with a leading "!" to re-include something an
+// earlier pattern excluded.
+type dockerignorePattern struct {
+	negate  bool
+	pattern string
+}
+
+// DockerignoreFilter is a ContextFilter that drops files matched by the
+// .dockerignore at the root of the build context, honoring negated
+// patterns (e.g. "!**/node_modules") the way BuildKit does: patterns are
+// evaluated in order and the last one to match a given path decides
+// whether it is excluded.
+type DockerignoreFilter struct{}
+
+// NewDockerignoreFilter returns a ContextFilter that applies the build
+// context's own .dockerignore file.
+func NewDockerignoreFilter() *DockerignoreFilter {
+	return &DockerignoreFilter{}
+}
+
+// Filter spools r to disk twice: once to read the .dockerignore file (which
+// may appear anywhere before the entries it excludes, since tar streams
+// aren't seekable), and once to rewrite the context with matching entries
+// removed.
+func (*DockerignoreFilter) Filter(r io.Reader) (io.Reader, error) {
+	spool, err := os.CreateTemp("", "build-context-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("spooling build context: %w", err)
+	}
+	// removed becomes true once ownership of spool has been handed to the
+	// caller (no .dockerignore patterns found); otherwise the deferred
+	// cleanup closes and deletes spool when Filter returns.
+	removed := false
+	defer func() {
+		if !removed {
+			spool.Close()
+			os.Remove(spool.Name())
+		}
+	}()
+
+	if _, err := io.Copy(spool, r); err != nil {
+		return nil, fmt.Errorf("spooling build context: %w", err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("spooling build context: %w", err)
+	}
+
+	patterns, err := readDockerignore(spool)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		removed = true
+		return &removeOnCloseFile{File: spool}, nil
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("spooling build context: %w", err)
+	}
+
+	out, err := os.CreateTemp("", "build-context-filtered-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("creating filtered build context: %w", err)
+	}
+	outOK := false
+	defer func() {
+		if !outOK {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+
+	tw := tar.NewWriter(out)
+	tr := tar.NewReader(spool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading build context: %w", err)
+		}
+		if hdr.Name == ".dockerignore" || matchesDockerignore(patterns, hdr.Name) {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	outOK = true
+	return &removeOnCloseFile{File: out}, nil
+}
+
+// readDockerignore scans a tar stream for a root-level .dockerignore file
+// and parses it into patterns. It returns no patterns, without error, if
+// none is present.
+func readDockerignore(r io.Reader) ([]dockerignorePattern, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading build context: %w", err)
+		}
+		if hdr.Name != ".dockerignore" {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading .dockerignore: %w", err)
+		}
+		return parseDockerignore(data), nil
+	}
+}
+
+func parseDockerignore(data []byte) []dockerignorePattern {
+	var patterns []dockerignorePattern
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := false
+		if strings.HasPrefix(line, "!") {
+			negate = true
+			line = strings.TrimSpace(line[1:])
+		}
+		patterns = append(patterns, dockerignorePattern{
+			negate:  negate,
+			pattern: filepath.ToSlash(filepath.Clean(line)),
+		})
+	}
+	return patterns
+}
+
+// matchesDockerignore reports whether name is excluded by patterns, taking
+// negation into account: the last pattern to match wins.
+func matchesDockerignore(patterns []dockerignorePattern, name string) bool {
+	name = filepath.ToSlash(filepath.Clean(name))
+	excluded := false
+	for _, p := range patterns {
+		if globMatch(p.pattern, name) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+// globMatch reports whether name matches pattern, supporting "**" as a
+// wildcard for any number of path segments (including zero), the same way
+// BuildKit's dockerignore matcher treats it. A pattern with no slashes and
+// no "**" also matches anything below a directory of that name, so
+// "node_modules" excludes "node_modules/left-pad/index.js".
+func globMatch(pattern, name string) bool {
+	pParts := strings.Split(pattern, "/")
+	nParts := strings.Split(name, "/")
+	if matchParts(pParts, nParts) {
+		return true
+	}
+	// Directory-style exclusion: a pattern matching a path prefix also
+	// excludes everything under it.
+	if len(nParts) > len(pParts) && matchParts(pParts, nParts[:len(pParts)]) {
+		return true
+	}
+	return false
+}
+
+func matchParts(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return true
+		}
+		for i := 0; i <= len(name); i++ {
+			if matchParts(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, err := filepath.Match(pattern[0], name[0]); err != nil || !ok {
+		return false
+	}
+	return matchParts(pattern[1:], name[1:])
+}
@@ -0,0 +1,64 @@
+package build
+
+import (
+	"bytes"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDockerignoreFilter_ExcludesMatchedFiles(t *testing.T) {
+	f := NewDockerignoreFilter()
+
+	input := writeTar(t, map[string]string{
+		".dockerignore":       "node_modules\n*.log\n",
+		"app/main.go":         "package main",
+		"node_modules/dep.js": "module.exports = {}",
+		"debug.log":           "oops",
+	})
+
+	out, err := f.Filter(bytes.NewReader(input))
+	assert.NilError(t, err)
+
+	entries := readTarNames(t, out)
+	_, hasMain := entries["app/main.go"]
+	_, hasDep := entries["node_modules/dep.js"]
+	_, hasLog := entries["debug.log"]
+	_, hasIgnoreFile := entries[".dockerignore"]
+
+	assert.Assert(t, hasMain)
+	assert.Assert(t, !hasDep)
+	assert.Assert(t, !hasLog)
+	assert.Assert(t, !hasIgnoreFile)
+}
+
+func TestDockerignoreFilter_NegatedPatternReincludes(t *testing.T) {
+	f := NewDockerignoreFilter()
+
+	input := writeTar(t, map[string]string{
+		".dockerignore":                 "node_modules\n!node_modules/keep-me\n",
+		"node_modules/dep.js":           "module.exports = {}",
+		"node_modules/keep-me/index.js": "module.exports = 'keep'",
+	})
+
+	out, err := f.Filter(bytes.NewReader(input))
+	assert.NilError(t, err)
+
+	entries := readTarNames(t, out)
+	_, hasDep := entries["node_modules/dep.js"]
+	_, hasKept := entries["node_modules/keep-me/index.js"]
+
+	assert.Assert(t, !hasDep)
+	assert.Assert(t, hasKept)
+}
+
+func TestDockerignoreFilter_NoDockerignorePassesThrough(t *testing.T) {
+	f := NewDockerignoreFilter()
+
+	input := writeTar(t, map[string]string{"app/main.go": "package main"})
+	out, err := f.Filter(bytes.NewReader(input))
+	assert.NilError(t, err)
+
+	entries := readTarNames(t, out)
+	assert.Equal(t, entries["app/main.go"], "package main")
+}
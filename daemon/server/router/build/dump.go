@@ -0,0 +1,226 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/moby/moby/v2/daemon/server/httputils"
+)
+
+// dumpContextSampleLimit and dumpResponseSampleLimit cap how much of a
+// build's context and response a dump file retains, so dumping a
+// multi-gigabyte context doesn't balloon daemon memory or disk use.
+const (
+	dumpContextSampleLimit  = 64 * 1024
+	dumpResponseSampleLimit = 64 * 1024
+)
+
+// redactedHeaderNames lists headers whose value must never be written to
+// a dump file verbatim.
+var redactedHeaderNames = map[string]bool{
+	"x-registry-config": true, // base64-encoded registry auth
+}
+
+var dumpSeq atomic.Uint64
+
+// buildDumpRecord is the JSON document persisted to dumpDir for one
+// /build request.
+type buildDumpRecord struct {
+	Time          time.Time         `json:"time"`
+	Method        string            `json:"method"`
+	Path          string            `json:"path"`
+	Query         map[string]string `json:"query"`
+	Headers       map[string]string `json:"headers"`
+	ContextBytes  int64             `json:"context_bytes"`
+	ContextSample []byte            `json:"context_sample"`
+	Response      []byte            `json:"response_sample"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// withDump wraps an APIFunc so every request it handles is recorded to
+// br.dumpDir, a no-op when dumping isn't configured. It tees the request
+// body and response through size-capped buffers rather than buffering
+// them wholesale, and the response tee implements Unwrap so
+// http.ResponseController (which postBuild uses for EnableFullDuplex)
+// still sees through to the real ResponseWriter.
+func (br *buildRouter) withDump(next httputils.APIFunc) httputils.APIFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		if br.dumpDir == "" {
+			return next(ctx, w, r, vars)
+		}
+
+		record := &buildDumpRecord{
+			Time:    time.Now(),
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Query:   redactValues(r.URL.Query()),
+			Headers: redactHeaders(r.Header),
+		}
+
+		contextTee := &capBuffer{limit: dumpContextSampleLimit}
+		if r.Body != nil {
+			r.Body = &teeReadCloser{ReadCloser: r.Body, tee: contextTee, counter: &record.ContextBytes}
+		}
+
+		responseTee := &capBuffer{limit: dumpResponseSampleLimit}
+		dw := &dumpResponseWriter{ResponseWriter: w, tee: responseTee}
+
+		err := next(ctx, dw, r, vars)
+
+		record.ContextSample = contextTee.Bytes()
+		record.Response = responseTee.Bytes()
+		if err != nil {
+			record.Error = err.Error()
+		}
+		br.writeDump(record)
+		return err
+	}
+}
+
+func (br *buildRouter) writeDump(record *buildDumpRecord) {
+	if err := os.MkdirAll(br.dumpDir, 0o700); err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return
+	}
+	name := fmt.Sprintf("%d-%04d.json", record.Time.UnixNano(), dumpSeq.Add(1))
+	_ = os.WriteFile(filepath.Join(br.dumpDir, name), data, 0o600)
+}
+
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k := range h {
+		if redactedHeaderNames[strings.ToLower(k)] || strings.Contains(strings.ToLower(k), "session") {
+			out[k] = "REDACTED"
+			continue
+		}
+		out[k] = strings.Join(h.Values(k), ",")
+	}
+	return out
+}
+
+func redactValues(v url.Values) map[string]string {
+	out := make(map[string]string, len(v))
+	for k := range v {
+		if strings.Contains(strings.ToLower(k), "session") {
+			out[k] = "REDACTED"
+			continue
+		}
+		out[k] = strings.Join(v[k], ",")
+	}
+	return out
+}
+
+// capBuffer is an io.Writer that keeps only the first limit bytes written
+// to it, discarding the rest, so tee-ing a multi-gigabyte build context
+// doesn't balloon daemon memory.
+type capBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *capBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if remaining := b.limit - b.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			p = p[:remaining]
+		}
+		b.buf.Write(p)
+	}
+	return n, nil
+}
+
+func (b *capBuffer) Bytes() []byte { return b.buf.Bytes() }
+
+type teeReadCloser struct {
+	io.ReadCloser
+	tee     io.Writer
+	counter *int64
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.tee.Write(p[:n])
+		*t.counter += int64(n)
+	}
+	return n, err
+}
+
+// dumpResponseWriter tees written bytes to tee while still exposing the
+// real http.ResponseWriter through Unwrap, so the response controller
+// postBuild uses for full-duplex streaming keeps working.
+type dumpResponseWriter struct {
+	http.ResponseWriter
+	tee *capBuffer
+}
+
+func (d *dumpResponseWriter) Write(p []byte) (int, error) {
+	d.tee.Write(p)
+	return d.ResponseWriter.Write(p)
+}
+
+func (d *dumpResponseWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// buildDumpInfo is one entry of the GET /build/dumps listing.
+type buildDumpInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// getBuildDumps lists captured request/response dumps. It is restricted
+// to the daemon's local socket since dumps may contain build output that
+// is otherwise only visible to whoever issued the build.
+func (br *buildRouter) getBuildDumps(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if !br.isLocalSocketRequest(r) {
+		http.Error(w, "build dumps are only available on the daemon's local socket", http.StatusForbidden)
+		return nil
+	}
+
+	var dumps []buildDumpInfo
+	if br.dumpDir != "" {
+		entries, err := os.ReadDir(br.dumpDir)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("listing build dumps: %w", err)
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			dumps = append(dumps, buildDumpInfo{Name: e.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		}
+		sort.Slice(dumps, func(i, j int) bool { return dumps[i].ModTime.After(dumps[j].ModTime) })
+	}
+	return httputils.WriteJSON(w, http.StatusOK, dumps)
+}
+
+// isLocalSocketRequest reports whether r arrived over the daemon's local
+// unix socket. net/http reports RemoteAddr as "@" or empty for
+// unix-socket connections rather than a host:port pair; callers that wire
+// up a more precise check can override it with WithLocalSocketCheck.
+func (br *buildRouter) isLocalSocketRequest(r *http.Request) bool {
+	if br.isLocalSocket != nil {
+		return br.isLocalSocket(r)
+	}
+	return r.RemoteAddr == "" || strings.HasPrefix(r.RemoteAddr, "@")
+}
@@ -0,0 +1,92 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+func TestWithDump_WritesRecordWithRedactedHeaders(t *testing.T) {
+	dir := t.TempDir()
+	br := &buildRouter{dumpDir: dir}
+
+	handler := br.withDump(func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"stream":"ok"}`))
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/build", strings.NewReader("tar-bytes"))
+	req.Header.Set("X-Registry-Config", "super-secret-token")
+	recorder := httptest.NewRecorder()
+
+	err := handler(req.Context(), recorder, req, nil)
+	assert.NilError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+
+	data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	assert.NilError(t, err)
+
+	var record buildDumpRecord
+	assert.NilError(t, json.Unmarshal(data, &record))
+	assert.Equal(t, record.Headers["X-Registry-Config"], "REDACTED")
+	assert.Equal(t, record.ContextBytes, int64(len("tar-bytes")))
+	assert.Equal(t, string(record.Response), `{"stream":"ok"}`)
+}
+
+func TestWithDump_NoopWithoutDumpDir(t *testing.T) {
+	br := &buildRouter{}
+	called := false
+	handler := br.withDump(func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		called = true
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/build", nil)
+	err := handler(req.Context(), httptest.NewRecorder(), req, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, called)
+}
+
+func TestGetBuildDumps_ForbiddenOverNetwork(t *testing.T) {
+	br := &buildRouter{dumpDir: t.TempDir()}
+
+	req := httptest.NewRequest(http.MethodGet, "/build/dumps", nil)
+	req.RemoteAddr = "10.0.0.5:12345"
+	recorder := httptest.NewRecorder()
+
+	err := br.getBuildDumps(req.Context(), recorder, req, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Equal(recorder.Code, http.StatusForbidden))
+}
+
+func TestGetBuildDumps_ListsFilesOverLocalSocket(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "1-0001.json"), []byte(`{}`), 0o600))
+
+	br := &buildRouter{dumpDir: dir}
+	req := httptest.NewRequest(http.MethodGet, "/build/dumps", nil)
+	req.RemoteAddr = "@"
+	recorder := httptest.NewRecorder()
+
+	err := br.getBuildDumps(req.Context(), recorder, req, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Equal(recorder.Code, http.StatusOK))
+
+	var dumps []buildDumpInfo
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), &dumps))
+	assert.Equal(t, len(dumps), 1)
+	assert.Equal(t, dumps[0].Name, "1-0001.json")
+}
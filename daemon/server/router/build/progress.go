@@ -0,0 +1,189 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/moby/moby/api/types/build"
+	"github.com/moby/moby/v2/daemon/server/buildbackend"
+)
+
+// progressMode is the response format negotiated for a build's progress
+// stream.
+type progressMode int
+
+const (
+	// progressModeClassic is the default: freeform `{"stream":...}`
+	// messages written straight to the response body.
+	progressModeClassic progressMode = iota
+	// progressModeNDJSON is the typed per-step event stream described by
+	// build.ProgressEvent.
+	progressModeNDJSON
+	// progressModeOTLP additionally packages the same events as an
+	// OTLP-over-HTTP span export.
+	progressModeOTLP
+)
+
+// negotiateProgressMode picks the response format for a build's progress
+// stream from the `Accept` header or `?progress=` query parameter.
+func negotiateProgressMode(r *http.Request) progressMode {
+	switch r.URL.Query().Get("progress") {
+	case build.ProgressQueryRawJSON:
+		return progressModeNDJSON
+	case build.ProgressQueryOTLP:
+		return progressModeOTLP
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		if strings.Contains(accept, build.ProgressAcceptHeader) {
+			return progressModeNDJSON
+		}
+	}
+	return progressModeClassic
+}
+
+// newProgressWriter builds the buildbackend.ProgressWriter for the response
+// mode negotiated on r, setting the appropriate Content-Type on w.
+func newProgressWriter(w http.ResponseWriter, r *http.Request) buildbackend.ProgressWriter {
+	switch negotiateProgressMode(r) {
+	case progressModeNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		return buildbackend.ProgressWriter{Output: w, StructuredSink: &ndjsonSink{w: w}}
+	case progressModeOTLP:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		return buildbackend.ProgressWriter{Output: w, StructuredSink: &otlpSink{w: w}}
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		return buildbackend.ProgressWriter{Output: w}
+	}
+}
+
+// ndjsonSink writes one JSON object per build.ProgressEvent, matching the
+// schema decoded by build.ProgressDecoder.
+type ndjsonSink struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+}
+
+func (s *ndjsonSink) Event(e build.ProgressEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := json.NewEncoder(s.w).Encode(e); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func (s *ndjsonSink) writeTerminal(v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := json.NewEncoder(s.w).Encode(v); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// otlpSpan is a minimal, dependency-free stand-in for an OTLP span, wide
+// enough to describe one build step's timing.
+type otlpSpan struct {
+	Name       string            `json:"name"`
+	StartTime  string            `json:"startTimeUnixNano"`
+	EndTime    string            `json:"endTimeUnixNano"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// otlpSink accumulates one span per build vertex and, on completion,
+// exports them as a single OTLP-over-HTTP JSON document so BuildKit-style
+// DAG progress can be scraped by tracing backends. It also emits the plain
+// NDJSON events as they arrive, so a client that only understands the v2
+// event schema still gets live progress.
+type otlpSink struct {
+	mu    sync.Mutex
+	w     http.ResponseWriter
+	spans map[string]*otlpSpan
+	order []string
+}
+
+func (s *otlpSink) Event(e build.ProgressEvent) error {
+	s.mu.Lock()
+	if s.spans == nil {
+		s.spans = make(map[string]*otlpSpan)
+	}
+	ts := strconv.FormatInt(e.Timestamp.UnixNano(), 10)
+	span, ok := s.spans[e.Vertex]
+	if !ok {
+		span = &otlpSpan{Name: e.Vertex, StartTime: ts}
+		s.spans[e.Vertex] = span
+		s.order = append(s.order, e.Vertex)
+	}
+	span.EndTime = ts
+	span.Attributes = map[string]string{
+		"build.step":   e.Step,
+		"build.status": e.Status,
+		"build.digest": e.Digest,
+	}
+	s.mu.Unlock()
+
+	return json.NewEncoder(s.w).Encode(e)
+}
+
+func (s *otlpSink) writeTerminal(v any) error {
+	s.mu.Lock()
+	spans := make([]*otlpSpan, len(s.order))
+	for i, name := range s.order {
+		spans[i] = s.spans[name]
+	}
+	s.mu.Unlock()
+
+	if err := json.NewEncoder(s.w).Encode(map[string]any{
+		"resourceSpans": []map[string]any{{
+			"scopeSpans": []map[string]any{{
+				"spans": spans,
+			}},
+		}},
+	}); err != nil {
+		return err
+	}
+	return json.NewEncoder(s.w).Encode(v)
+}
+
+// terminalSink is implemented by structured-mode sinks (ndjsonSink,
+// otlpSink, and activeBuildSink wrapping either) to write the terminal
+// result/error frame once a build finishes.
+type terminalSink interface {
+	writeTerminal(any) error
+}
+
+// writeBuildOutcome writes the terminal frame for a build. In structured
+// modes this is the typed `{"result":...}`/`{"error":...}` frame written
+// into the already-started stream, so a build failure after progress has
+// begun is reported in-band rather than as an HTTP error status. In
+// classic mode it preserves the existing freeform success message and
+// surfaces errors to the caller as before.
+func writeBuildOutcome(pw buildbackend.ProgressWriter, imageID string, buildErr error) error {
+	sink, structured := pw.StructuredSink.(terminalSink)
+	if !structured {
+		if buildErr != nil {
+			return buildErr
+		}
+		_, err := pw.Output.Write([]byte(`{"stream":"Successfully built ` + imageID + `\n"}`))
+		return err
+	}
+
+	if buildErr != nil {
+		return sink.writeTerminal(map[string]build.ProgressError{
+			"error": {Message: buildErr.Error()},
+		})
+	}
+	return sink.writeTerminal(map[string]build.ProgressResult{
+		"result": {ImageID: imageID},
+	})
+}
@@ -0,0 +1,115 @@
+package build
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/moby/moby/api/types/build"
+)
+
+func TestNegotiateProgressMode(t *testing.T) {
+	cases := []struct {
+		name   string
+		query  string
+		accept string
+		want   progressMode
+	}{
+		{name: "default", want: progressModeClassic},
+		{name: "query rawjson", query: build.ProgressQueryRawJSON, want: progressModeNDJSON},
+		{name: "query otlp", query: build.ProgressQueryOTLP, want: progressModeOTLP},
+		{name: "accept header", accept: build.ProgressAcceptHeader, want: progressModeNDJSON},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := "/build"
+			if tc.query != "" {
+				url += "?progress=" + tc.query
+			}
+			req := httptest.NewRequest("POST", url, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			assert.Equal(t, negotiateProgressMode(req), tc.want)
+		})
+	}
+}
+
+func TestNDJSONSink_EncodesOneEventPerLine(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	sink := &ndjsonSink{w: recorder}
+
+	assert.NilError(t, sink.Event(build.ProgressEvent{Vertex: "step1", Step: "RUN echo hi", Status: "running"}))
+	assert.NilError(t, sink.Event(build.ProgressEvent{Vertex: "step2", Step: "COPY .", Status: "complete", Cached: true}))
+
+	dec := build.NewProgressDecoder(recorder.Body)
+	msg, err := dec.Decode()
+	assert.NilError(t, err)
+	assert.Assert(t, msg.Event != nil)
+	assert.Equal(t, msg.Event.Vertex, "step1")
+
+	msg, err = dec.Decode()
+	assert.NilError(t, err)
+	assert.Assert(t, msg.Event != nil)
+	assert.Equal(t, msg.Event.Cached, true)
+}
+
+func TestOTLPSink_WriteTerminalEmitsSpanExportBeforeResult(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	sink := &otlpSink{w: recorder}
+
+	assert.NilError(t, sink.Event(build.ProgressEvent{
+		Timestamp: time.Unix(0, 0),
+		Vertex:    "step1",
+		Step:      "RUN echo hi",
+		Status:    "complete",
+	}))
+	assert.NilError(t, sink.writeTerminal(map[string]build.ProgressResult{
+		"result": {ImageID: "sha256:deadbeef"},
+	}))
+
+	// Event writes the plain NDJSON event line as it arrives; writeTerminal
+	// then writes the span export on its own line followed by the terminal
+	// result frame. The span export isn't a ProgressMessage, so decode it
+	// directly rather than via ProgressDecoder.
+	lines := strings.Split(strings.TrimSuffix(recorder.Body.String(), "\n"), "\n")
+	assert.Equal(t, len(lines), 3)
+
+	var spansDoc map[string]any
+	assert.NilError(t, json.Unmarshal([]byte(lines[1]), &spansDoc))
+	assert.Assert(t, spansDoc["resourceSpans"] != nil)
+	assert.Assert(t, strings.Contains(lines[2], `"result"`))
+}
+
+func TestWriteBuildOutcome_ClassicMode(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/build", nil)
+	pw := newProgressWriter(recorder, req)
+
+	err := writeBuildOutcome(pw, "test-image-id", nil)
+	assert.NilError(t, err)
+	assert.Assert(t, len(recorder.Body.Bytes()) > 0)
+}
+
+func TestWriteBuildOutcome_StructuredModeReportsError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/build?progress="+build.ProgressQueryRawJSON, nil)
+	pw := newProgressWriter(recorder, req)
+
+	err := writeBuildOutcome(pw, "", errBoom("boom"))
+	assert.NilError(t, err)
+
+	dec := build.NewProgressDecoder(recorder.Body)
+	msg, err := dec.Decode()
+	assert.NilError(t, err)
+	assert.Assert(t, msg.Error != nil)
+	assert.Equal(t, msg.Error.Message, "boom")
+}
+
+type errBoom string
+
+func (e errBoom) Error() string { return string(e) }
@@ -0,0 +1,152 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/moby/moby/api/types/build"
+	"github.com/moby/moby/v2/daemon/server/buildbackend"
+)
+
+// activeBuild tracks a build that postBuild registered under a client
+// supplied buildid, so that it can be inspected or cancelled through
+// getBuildStatus/postBuildCancel while it is still running.
+type activeBuild struct {
+	id        string
+	cancel    context.CancelFunc
+	startedAt time.Time
+
+	bytesRead   int64
+	cacheHits   int64
+	cacheTotal  int64
+	currentStep atomic.Value
+}
+
+func newActiveBuild(id string, cancel context.CancelFunc) *activeBuild {
+	b := &activeBuild{id: id, cancel: cancel, startedAt: time.Now()}
+	b.currentStep.Store("")
+	return b
+}
+
+// trackEvent folds one build.ProgressEvent into the running status,
+// letting getBuildStatus report the current step and cache-hit ratio.
+func (b *activeBuild) trackEvent(e build.ProgressEvent) {
+	b.currentStep.Store(e.Step)
+	atomic.AddInt64(&b.cacheTotal, 1)
+	if e.Cached {
+		atomic.AddInt64(&b.cacheHits, 1)
+	}
+}
+
+// countingReader wraps the build context reader so bytesRead reflects how
+// much of it the builder has consumed so far.
+func (b *activeBuild) countingReader(rc io.ReadCloser) io.ReadCloser {
+	return &countingReadCloser{ReadCloser: rc, counter: &b.bytesRead}
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	counter *int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(c.counter, int64(n))
+	return n, err
+}
+
+// buildStatus is the JSON body returned by getBuildStatus.
+type buildStatus struct {
+	ID             string  `json:"id"`
+	BytesRead      int64   `json:"bytes_read"`
+	CurrentStep    string  `json:"current_step"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	CacheHitRatio  float64 `json:"cache_hit_ratio"`
+}
+
+func (b *activeBuild) snapshot() buildStatus {
+	total := atomic.LoadInt64(&b.cacheTotal)
+	hits := atomic.LoadInt64(&b.cacheHits)
+	var ratio float64
+	if total > 0 {
+		ratio = float64(hits) / float64(total)
+	}
+	step, _ := b.currentStep.Load().(string)
+	return buildStatus{
+		ID:             b.id,
+		BytesRead:      atomic.LoadInt64(&b.bytesRead),
+		CurrentStep:    step,
+		ElapsedSeconds: time.Since(b.startedAt).Seconds(),
+		CacheHitRatio:  ratio,
+	}
+}
+
+func (br *buildRouter) registerActiveBuild(id string, cancel context.CancelFunc) *activeBuild {
+	active := newActiveBuild(id, cancel)
+	br.activeMu.Lock()
+	br.activeBuilds[id] = active
+	br.activeMu.Unlock()
+	return active
+}
+
+func (br *buildRouter) unregisterActiveBuild(id string) {
+	br.activeMu.Lock()
+	delete(br.activeBuilds, id)
+	br.activeMu.Unlock()
+}
+
+func (br *buildRouter) getActiveBuild(id string) (*activeBuild, bool) {
+	br.activeMu.Lock()
+	defer br.activeMu.Unlock()
+	active, ok := br.activeBuilds[id]
+	return active, ok
+}
+
+// wrapSink returns a ProgressSink that feeds every event into active's
+// status counters in addition to whatever inner does, so getBuildStatus
+// reports current_step/cache_hit_ratio regardless of the response mode
+// negotiated for the build (inner is nil in classic mode, since
+// newProgressWriter only sets StructuredSink for the NDJSON/OTLP modes).
+// The returned sink only implements terminalSink when inner does, so
+// writeBuildOutcome's structured/classic detection still reflects the
+// negotiated mode rather than the presence of status tracking.
+func (b *activeBuild) wrapSink(inner buildbackend.ProgressSink) buildbackend.ProgressSink {
+	if inner == nil {
+		return &activeBuildTrackingSink{active: b}
+	}
+	return &activeBuildSink{active: b, inner: inner}
+}
+
+// activeBuildTrackingSink feeds events into active's status counters for a
+// build that didn't negotiate a structured response format. It does not
+// implement terminalSink, so it never changes how the build's outcome is
+// written.
+type activeBuildTrackingSink struct {
+	active *activeBuild
+}
+
+func (s *activeBuildTrackingSink) Event(e build.ProgressEvent) error {
+	s.active.trackEvent(e)
+	return nil
+}
+
+// activeBuildSink forwards progress events to inner while also feeding
+// them into active's status counters.
+type activeBuildSink struct {
+	active *activeBuild
+	inner  buildbackend.ProgressSink
+}
+
+func (s *activeBuildSink) Event(e build.ProgressEvent) error {
+	s.active.trackEvent(e)
+	return s.inner.Event(e)
+}
+
+func (s *activeBuildSink) writeTerminal(v any) error {
+	if t, ok := s.inner.(terminalSink); ok {
+		return t.writeTerminal(v)
+	}
+	return nil
+}
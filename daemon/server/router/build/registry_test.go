@@ -0,0 +1,162 @@
+package build
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+
+	"github.com/moby/moby/api/types/build"
+	"github.com/moby/moby/v2/daemon/server/buildbackend"
+)
+
+func TestActiveBuildRegistry_RegisterAndSnapshot(t *testing.T) {
+	br := &buildRouter{
+		backend:      &mockBackend{},
+		activeBuilds: make(map[string]*activeBuild),
+	}
+
+	_, cancel := context.WithCancel(context.Background())
+	active := br.registerActiveBuild("build-1", cancel)
+	active.trackEvent(build.ProgressEvent{Step: "RUN echo hi", Cached: false})
+	active.trackEvent(build.ProgressEvent{Step: "COPY .", Cached: true})
+
+	got, ok := br.getActiveBuild("build-1")
+	assert.Assert(t, ok)
+	snap := got.snapshot()
+	assert.Equal(t, snap.CurrentStep, "COPY .")
+	assert.Equal(t, snap.CacheHitRatio, 0.5)
+
+	br.unregisterActiveBuild("build-1")
+	_, ok = br.getActiveBuild("build-1")
+	assert.Assert(t, !ok)
+}
+
+func TestGetBuildStatus_UnknownID(t *testing.T) {
+	br := &buildRouter{activeBuilds: make(map[string]*activeBuild)}
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/build/missing", nil)
+	err := br.getBuildStatus(req.Context(), recorder, req, map[string]string{"id": "missing"})
+	assert.NilError(t, err)
+	assert.Assert(t, is.Equal(recorder.Code, 404))
+}
+
+func TestPostBuildCancel_CancelsRegisteredBuild(t *testing.T) {
+	var cancelledBackendID string
+	br := &buildRouter{
+		backend: &mockBackend{
+			cancelFunc: func(ctx context.Context, id string) error {
+				cancelledBackendID = id
+				return nil
+			},
+		},
+		activeBuilds: make(map[string]*activeBuild),
+	}
+
+	cancelled := false
+	_, cancel := context.WithCancel(context.Background())
+	active := newActiveBuild("build-2", func() { cancelled = true; cancel() })
+	br.activeMu.Lock()
+	br.activeBuilds["build-2"] = active
+	br.activeMu.Unlock()
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/build/build-2/cancel", nil)
+	err := br.postBuildCancel(req.Context(), recorder, req, map[string]string{"id": "build-2"})
+	assert.NilError(t, err)
+	assert.Equal(t, cancelledBackendID, "build-2")
+	assert.Assert(t, cancelled)
+	assert.Assert(t, is.Equal(recorder.Code, 204))
+}
+
+func TestCountingReader_TracksBytesRead(t *testing.T) {
+	active := newActiveBuild("build-3", func() {})
+	rc := active.countingReader(io.NopCloser(strings.NewReader("hello world")))
+
+	buf := make([]byte, 5)
+	n, err := rc.Read(buf)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 5)
+	assert.Equal(t, active.snapshot().BytesRead, int64(5))
+}
+
+// TestWrapSink_TracksStatusInClassicMode guards against GET /build/{id}
+// always reporting a stale current_step/cache_hit_ratio for classic-mode
+// builds: newProgressWriter leaves StructuredSink nil outside the
+// NDJSON/OTLP modes, so wrapSink must still install something that feeds
+// active's counters.
+func TestWrapSink_TracksStatusInClassicMode(t *testing.T) {
+	active := newActiveBuild("build-4", func() {})
+
+	sink := active.wrapSink(nil)
+	assert.NilError(t, sink.Event(build.ProgressEvent{Step: "RUN echo hi", Cached: true}))
+
+	snap := active.snapshot()
+	assert.Equal(t, snap.CurrentStep, "RUN echo hi")
+	assert.Equal(t, snap.CacheHitRatio, 1.0)
+
+	// Classic mode must not gain a terminal frame: wrapSink(nil) tracks
+	// status but mustn't make writeBuildOutcome think this build
+	// negotiated a structured response.
+	_, structured := sink.(terminalSink)
+	assert.Assert(t, !structured)
+}
+
+func TestWrapSink_ForwardsAndTracksInStructuredMode(t *testing.T) {
+	active := newActiveBuild("build-5", func() {})
+	recorder := httptest.NewRecorder()
+	inner := &ndjsonSink{w: recorder}
+
+	sink := active.wrapSink(inner)
+	assert.NilError(t, sink.Event(build.ProgressEvent{Step: "COPY .", Cached: false}))
+
+	assert.Equal(t, active.snapshot().CurrentStep, "COPY .")
+	assert.Assert(t, recorder.Body.Len() > 0, "event should still reach the structured sink")
+
+	sinkWithTerminal, structured := sink.(terminalSink)
+	assert.Assert(t, structured)
+	assert.NilError(t, sinkWithTerminal.writeTerminal(map[string]string{"result": "ok"}))
+}
+
+// TestPostBuild_TracksStatusForClassicModeClient is the regression test
+// for getBuildStatus always reporting a blank current_step/zero
+// cache_hit_ratio for classic-mode clients (the common case, since
+// structured progress is opt-in): it drives postBuild end-to-end with a
+// classic (non-NDJSON) request and confirms the backend's progress event,
+// fed through config.ProgressWriter.StructuredSink, lands in the
+// registered activeBuild's status.
+func TestPostBuild_TracksStatusForClassicModeClient(t *testing.T) {
+	var snap buildStatus
+	br := &buildRouter{
+		daemon:       &mockDaemon{},
+		activeBuilds: make(map[string]*activeBuild),
+	}
+	br.backend = &mockBackend{
+		buildFunc: func(ctx context.Context, config buildbackend.BuildConfig) (string, error) {
+			assert.Assert(t, config.ProgressWriter.StructuredSink != nil, "classic-mode builds must still get a sink for status tracking")
+			assert.NilError(t, config.ProgressWriter.StructuredSink.Event(build.ProgressEvent{Step: "RUN make", Cached: true}))
+
+			active, ok := br.getActiveBuild("classic-1")
+			assert.Assert(t, ok)
+			snap = active.snapshot()
+			return "test-image-id", nil
+		},
+	}
+
+	req := httptest.NewRequest("POST", "/build?buildid=classic-1", strings.NewReader("context"))
+	recorder := httptest.NewRecorder()
+
+	err := br.postBuild(req.Context(), recorder, req, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, snap.CurrentStep, "RUN make")
+	assert.Equal(t, snap.CacheHitRatio, 1.0)
+
+	// The classic `{"stream":...}` contract must be preserved even though
+	// a sink is now wired up purely for tracking.
+	assert.Assert(t, strings.Contains(recorder.Body.String(), "Successfully built"))
+}
@@ -0,0 +1,138 @@
+package build // import "github.com/moby/moby/v2/daemon/server/router/build"
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultStagingDir is used when a buildRouter is constructed without an
+// explicit WithStagingDir option.
+const defaultStagingDir = "/var/lib/docker/build-context-uploads"
+
+// resumableUpload tracks a build context that is being uploaded in chunks
+// using the TUS-inspired protocol implemented by postBuildContext,
+// patchBuildContext, headBuildContext and deleteBuildContext.
+type resumableUpload struct {
+	id   string
+	path string
+
+	mu     sync.Mutex
+	offset int64
+	length int64
+}
+
+// validUploadID reports whether id is safe to use as a filesystem path
+// component. The {id:.*} route var is deliberately unanchored so buildids
+// can contain slashes in principle, but a client-controlled id is never
+// allowed to escape stagingDir.
+func validUploadID(id string) bool {
+	return id != "" && !strings.Contains(id, "/") && !strings.Contains(id, `\`) && id != ".." && id != "."
+}
+
+func (br *buildRouter) uploadPath(id string) (string, error) {
+	if !validUploadID(id) {
+		return "", fmt.Errorf("invalid build context upload id %q", id)
+	}
+	return filepath.Join(br.stagingDir, id+".tar.partial"), nil
+}
+
+func (br *buildRouter) newUpload(id string, length int64) (*resumableUpload, error) {
+	if err := os.MkdirAll(br.stagingDir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating build context staging dir: %w", err)
+	}
+	path, err := br.uploadPath(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("creating staged build context: %w", err)
+	}
+	defer f.Close()
+
+	u := &resumableUpload{id: id, path: path, length: length}
+
+	br.mu.Lock()
+	br.uploads[id] = u
+	br.mu.Unlock()
+	return u, nil
+}
+
+func (br *buildRouter) getUpload(id string) (*resumableUpload, bool) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	u, ok := br.uploads[id]
+	return u, ok
+}
+
+func (br *buildRouter) removeUpload(id string) {
+	br.mu.Lock()
+	u, ok := br.uploads[id]
+	delete(br.uploads, id)
+	br.mu.Unlock()
+	if ok {
+		_ = os.Remove(u.path)
+	}
+}
+
+// appendChunk writes the given bytes at the upload's current offset and
+// returns the new offset. It fails if offset does not match the caller's
+// expectation, matching the TUS PATCH semantics.
+func (u *resumableUpload) appendChunk(expectedOffset int64, data []byte) (int64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if expectedOffset != u.offset {
+		return u.offset, fmt.Errorf("upload offset mismatch: have %d, client sent %d", u.offset, expectedOffset)
+	}
+
+	f, err := os.OpenFile(u.path, os.O_WRONLY, 0o600)
+	if err != nil {
+		return u.offset, fmt.Errorf("opening staged build context: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(u.offset, 0); err != nil {
+		return u.offset, fmt.Errorf("seeking staged build context: %w", err)
+	}
+	n, err := f.Write(data)
+	u.offset += int64(n)
+	if err != nil {
+		return u.offset, fmt.Errorf("writing staged build context: %w", err)
+	}
+	return u.offset, nil
+}
+
+// complete reports whether all bytes declared by Upload-Length have been
+// received.
+func (u *resumableUpload) complete() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.offset >= u.length
+}
+
+// openStagedContext opens an assembled build context for reading and
+// arranges for the staging file to be removed once it is closed.
+func openStagedContext(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening assembled build context: %w", err)
+	}
+	return &removeOnCloseFile{File: f}, nil
+}
+
+// removeOnCloseFile deletes the underlying staged tar file once the reader
+// built from it is closed, so completed uploads don't accumulate on disk.
+type removeOnCloseFile struct {
+	*os.File
+}
+
+func (f *removeOnCloseFile) Close() error {
+	err := f.File.Close()
+	_ = os.Remove(f.File.Name())
+	return err
+}
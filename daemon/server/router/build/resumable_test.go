@@ -0,0 +1,87 @@
+package build
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+func newTestRouter(t *testing.T) *buildRouter {
+	t.Helper()
+	return &buildRouter{
+		backend:    &mockBackend{},
+		daemon:     &mockDaemon{},
+		stagingDir: t.TempDir(),
+		uploads:    make(map[string]*resumableUpload),
+	}
+}
+
+func TestResumableUpload_AppendAndComplete(t *testing.T) {
+	br := newTestRouter(t)
+
+	u, err := br.newUpload("abc123", 10)
+	assert.NilError(t, err)
+	assert.Assert(t, !u.complete())
+
+	offset, err := u.appendChunk(0, []byte("hello"))
+	assert.NilError(t, err)
+	assert.Equal(t, offset, int64(5))
+	assert.Assert(t, !u.complete())
+
+	offset, err = u.appendChunk(5, []byte("world"))
+	assert.NilError(t, err)
+	assert.Equal(t, offset, int64(10))
+	assert.Assert(t, u.complete())
+
+	rc, err := openStagedContext(u.path)
+	assert.NilError(t, err)
+	defer rc.Close()
+}
+
+func TestResumableUpload_OffsetMismatch(t *testing.T) {
+	br := newTestRouter(t)
+
+	u, err := br.newUpload("mismatch", 10)
+	assert.NilError(t, err)
+
+	_, err = u.appendChunk(3, []byte("oops"))
+	assert.ErrorContains(t, err, "offset mismatch")
+}
+
+func TestRemoveUpload_DeletesStagedFile(t *testing.T) {
+	br := newTestRouter(t)
+
+	u, err := br.newUpload("to-remove", 5)
+	assert.NilError(t, err)
+	path := u.path
+
+	br.removeUpload("to-remove")
+	_, ok := br.getUpload("to-remove")
+	assert.Assert(t, !ok)
+
+	_, err = openStagedContext(path)
+	assert.Assert(t, err != nil, "staged file should have been removed")
+}
+
+func TestNewUpload_RejectsPathTraversalID(t *testing.T) {
+	br := newTestRouter(t)
+
+	for _, id := range []string{"../../etc/cron.d/evil", "a/b", `a\b`, "..", "."} {
+		_, err := br.newUpload(id, 1)
+		assert.Assert(t, err != nil, "id %q should have been rejected", id)
+		_, ok := br.getUpload(id)
+		assert.Assert(t, !ok)
+	}
+}
+
+func TestHeadBuildContext_UnknownID(t *testing.T) {
+	br := newTestRouter(t)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("HEAD", "/build/does-not-exist", nil)
+	err := br.headBuildContext(req.Context(), recorder, req, map[string]string{"id": "does-not-exist"})
+	assert.NilError(t, err)
+	assert.Assert(t, is.Equal(recorder.Code, 404))
+}
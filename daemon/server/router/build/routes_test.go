@@ -0,0 +1,78 @@
+package build
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/moby/moby/v2/daemon/server/router"
+)
+
+var muxVarPattern = regexp.MustCompile(`\{[a-zA-Z0-9_]+(:[^}]*)?\}`)
+
+// muxPatternToRegexp translates a gorilla-mux-style path template like
+// "/build/{id:.*}/cancel" into the regexp it compiles to, so matchRoute
+// below exercises the same "first registered route whose full path
+// matches wins" semantics as the real mux, including its susceptibility
+// to a permissive {id:.*} segment swallowing longer literal suffixes.
+func muxPatternToRegexp(path string) *regexp.Regexp {
+	if !muxVarPattern.MatchString(path) {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(path) + "$")
+	}
+	var out strings.Builder
+	last := 0
+	for _, loc := range muxVarPattern.FindAllStringIndex(path, -1) {
+		out.WriteString(regexp.QuoteMeta(path[last:loc[0]]))
+		seg := path[loc[0]:loc[1]]
+		if idx := strings.Index(seg, ":"); idx != -1 {
+			out.WriteString(seg[idx+1 : len(seg)-1])
+		} else {
+			out.WriteString("[^/]+")
+		}
+		last = loc[1]
+	}
+	out.WriteString(regexp.QuoteMeta(path[last:]))
+	return regexp.MustCompile("^" + out.String() + "$")
+}
+
+// matchRoute returns the first route (in registration order) whose method
+// and compiled path pattern match, mirroring how moby's mux resolves a
+// request: first registration wins, not longest/most-specific pattern.
+func matchRoute(routes []router.Route, method, path string) router.Route {
+	for _, rt := range routes {
+		if rt.Method() != method {
+			continue
+		}
+		if muxPatternToRegexp(rt.Path()).MatchString(path) {
+			return rt
+		}
+	}
+	return nil
+}
+
+// TestInitRoutes_CancelRegisteredBeforeCatchAll guards against the
+// catch-all POST /build/{id:.*} route (postBuildContext) shadowing POST
+// /build/{id:.*}/cancel: {id:.*} matches slashes, and routes are matched
+// in registration order, so the longer-suffix literal route must be
+// registered first or every cancel request is swallowed by
+// postBuildContext instead of reaching postBuildCancel.
+func TestInitRoutes_CancelRegisteredBeforeCatchAll(t *testing.T) {
+	br := &buildRouter{}
+	br.initRoutes()
+
+	rt := matchRoute(br.routes, http.MethodPost, "/build/some-build-id/cancel")
+	assert.Assert(t, rt != nil, "no route matched POST /build/{id}/cancel")
+	assert.Equal(t, rt.Path(), "/build/{id:.*}/cancel")
+}
+
+func TestInitRoutes_PlainIDStillResolvesToPostBuildContext(t *testing.T) {
+	br := &buildRouter{}
+	br.initRoutes()
+
+	rt := matchRoute(br.routes, http.MethodPost, "/build/some-build-id")
+	assert.Assert(t, rt != nil, "no route matched POST /build/{id}")
+	assert.Equal(t, rt.Path(), "/build/{id:.*}")
+}
@@ -0,0 +1,20 @@
+package router // import "github.com/moby/moby/v2/daemon/server/router"
+
+import "github.com/moby/moby/v2/daemon/server/httputils"
+
+// Router defines an interface to specify a group of routes to add to the
+// Docker API.
+type Router interface {
+	// Routes returns the list of routes to add to the router.
+	Routes() []Route
+}
+
+// Route defines an individual API route in the Docker API.
+type Route interface {
+	// Handler returns the raw function to create the http handler.
+	Handler() httputils.APIFunc
+	// Method returns the http method that the route responds to.
+	Method() string
+	// Path returns the subpath that this route responds to.
+	Path() string
+}